@@ -0,0 +1,173 @@
+// Copyright (C) 2018 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package graph_visualization
+
+import (
+	"archive/zip"
+	"bytes"
+	"fmt"
+	"html"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// getFrameNumbers returns the sorted, de-duplicated set of frame numbers
+// that joinNodesByFrame has stamped into node labels as a "FRAME<n>/" prefix.
+func (g *graph) getFrameNumbers() []int {
+	seen := map[int]bool{}
+	frameNumbers := []int{}
+	for _, currentNode := range g.getSortedNodes() {
+		frameNumber, ok := parseFrameNumber(currentNode.label)
+		if !ok {
+			continue
+		}
+		if !seen[frameNumber] {
+			seen[frameNumber] = true
+			frameNumbers = append(frameNumbers, frameNumber)
+		}
+	}
+	sort.Ints(frameNumbers)
+	return frameNumbers
+}
+
+// parseFrameNumber extracts n from a label of the form "FRAME<n>/...".
+func parseFrameNumber(label string) (int, bool) {
+	if !strings.HasPrefix(label, FRAME) {
+		return 0, false
+	}
+	rest := label[len(FRAME):]
+	slash := strings.Index(rest, "/")
+	if slash < 0 {
+		return 0, false
+	}
+	frameNumber, err := strconv.Atoi(rest[:slash])
+	if err != nil {
+		return 0, false
+	}
+	return frameNumber, true
+}
+
+// getGraphInDotFormatForFrame writes a DOT graph containing only the nodes
+// labelled with the given frame number, and the edges between them.
+func (g *graph) getGraphInDotFormatForFrame(frameNumber int) []byte {
+	nodes := g.getSortedNodes()
+	inFrame := map[int]bool{}
+	for _, currentNode := range nodes {
+		if n, ok := parseFrameNumber(currentNode.label); ok && n == frameNumber {
+			inFrame[currentNode.id] = true
+		}
+	}
+
+	var output bytes.Buffer
+	output.WriteString("digraph g {\n")
+	for _, currentNode := range nodes {
+		if inFrame[currentNode.id] {
+			fmt.Fprintf(&output, "%d[label=%s];\n", currentNode.id, currentNode.label)
+		}
+	}
+	for _, currentNode := range nodes {
+		if !inFrame[currentNode.id] {
+			continue
+		}
+		for _, neighbour := range g.getSortedNeighbours(currentNode.inNeighbourIdToEdgeId) {
+			if inFrame[neighbour.id] {
+				fmt.Fprintf(&output, "%d -> %d;\n", neighbour.id, currentNode.id)
+			}
+		}
+	}
+	output.WriteString("}\n")
+	return output.Bytes()
+}
+
+// WriteVisualizationBundle packages the graph as a single zip archive
+// containing the full graph in DOT and TensorFlow pbtxt format, one DOT
+// subgraph per frame discovered by joinNodesByFrame, and an index.html that
+// links to all of them. This lets callers hand users one downloadable
+// artefact instead of a bare DOT dump they have to post-process themselves.
+func (g *graph) WriteVisualizationBundle(w io.Writer) error {
+	zipWriter := zip.NewWriter(w)
+
+	if err := writeZipFile(zipWriter, "graph.dot", g.getGraphInDotFormat()); err != nil {
+		return err
+	}
+	if err := writeZipFile(zipWriter, "graph.pbtxt", g.getGraphInPbtxtFormat()); err != nil {
+		return err
+	}
+
+	frameNumbers := g.getFrameNumbers()
+	for _, frameNumber := range frameNumbers {
+		name := fmt.Sprintf("frame%03d.dot", frameNumber)
+		if err := writeZipFile(zipWriter, name, g.getGraphInDotFormatForFrame(frameNumber)); err != nil {
+			return err
+		}
+	}
+
+	if err := writeZipFile(zipWriter, "index.html", g.getVisualizationBundleIndexHtml(frameNumbers)); err != nil {
+		return err
+	}
+
+	return zipWriter.Close()
+}
+
+func writeZipFile(zipWriter *zip.Writer, name string, contents []byte) error {
+	fileWriter, err := zipWriter.Create(name)
+	if err != nil {
+		return err
+	}
+	_, err = fileWriter.Write(contents)
+	return err
+}
+
+// getVisualizationBundleIndexHtml builds the index.html that links to every
+// artefact in the bundle, with a legend for the label prefixes this package
+// emits (FRAME*, UNUSED, SCC*) and a placeholder for the rendered SVG, which
+// the caller is expected to fill in by running the DOT files through
+// graphviz.
+func (g *graph) getVisualizationBundleIndexHtml(frameNumbers []int) []byte {
+	var output bytes.Buffer
+	output.WriteString("<!DOCTYPE html>\n<html>\n<head><title>Capture dependency graph</title></head>\n<body>\n")
+
+	output.WriteString("<h1>Capture dependency graph</h1>\n")
+	output.WriteString("<ul>\n")
+	fmt.Fprintf(&output, "<li><a href=\"%s\">%s</a></li>\n", "graph.dot", html.EscapeString("graph.dot"))
+	fmt.Fprintf(&output, "<li><a href=\"%s\">%s</a></li>\n", "graph.pbtxt", html.EscapeString("graph.pbtxt"))
+	for _, frameNumber := range frameNumbers {
+		name := fmt.Sprintf("frame%03d.dot", frameNumber)
+		fmt.Fprintf(&output, "<li><a href=\"%s\">%s</a></li>\n", name, html.EscapeString(name))
+	}
+	output.WriteString("</ul>\n")
+
+	output.WriteString("<h2>Rendered graph</h2>\n")
+	output.WriteString("<div id=\"graph-svg\"><!-- Render graph.dot with graphviz (e.g. `dot -Tsvg graph.dot`) and place the output here. --></div>\n")
+
+	output.WriteString("<h2>Nodes</h2>\n")
+	output.WriteString("<ul>\n")
+	for _, currentNode := range g.getSortedNodes() {
+		fmt.Fprintf(&output, "<li>%d: %s</li>\n", currentNode.id, html.EscapeString(currentNode.label))
+	}
+	output.WriteString("</ul>\n")
+
+	output.WriteString("<h2>Label legend</h2>\n")
+	output.WriteString("<ul>\n")
+	fmt.Fprintf(&output, "<li><code>%s</code>: node belongs to the given capture frame.</li>\n", html.EscapeString(FRAME+"n/"))
+	fmt.Fprintf(&output, "<li><code>%s</code>: node has no edges and is unreachable from any frame.</li>\n", html.EscapeString(UNUSED+"/"))
+	output.WriteString("<li><code>SCCn</code>: node's command type belongs to the given strongly connected component of the command-type graph; for a non-trivial component it is followed by its shortest cycle in brackets.</li>\n")
+	output.WriteString("</ul>\n")
+
+	output.WriteString("</body>\n</html>\n")
+	return output.Bytes()
+}
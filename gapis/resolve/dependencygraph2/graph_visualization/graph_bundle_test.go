@@ -0,0 +1,68 @@
+// Copyright (C) 2018 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package graph_visualization
+
+import (
+	"archive/zip"
+	"bytes"
+	"testing"
+)
+
+func makeTwoFrameGraph() *graph {
+	g := createGraph(4)
+	g.addEdgeBetweenNodesById(1, 2)
+	g.addEdgeBetweenNodesById(3, 4)
+	g.nodeIdToNode[1].isEndOfFrame = true
+	g.nodeIdToNode[3].isEndOfFrame = true
+	g.joinNodesByFrame()
+	return g
+}
+
+func TestWriteVisualizationBundleContainsExpectedFiles(t *testing.T) {
+	g := makeTwoFrameGraph()
+
+	var buf bytes.Buffer
+	if err := g.WriteVisualizationBundle(&buf); err != nil {
+		t.Fatalf("WriteVisualizationBundle returned an error: %v", err)
+	}
+
+	reader, err := zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	if err != nil {
+		t.Fatalf("bundle is not a valid zip archive: %v", err)
+	}
+
+	names := map[string]bool{}
+	for _, f := range reader.File {
+		names[f.Name] = true
+	}
+
+	for _, want := range []string{"graph.dot", "graph.pbtxt", "frame001.dot", "frame002.dot", "index.html"} {
+		if !names[want] {
+			t.Errorf("expected bundle to contain %s, got %v", want, names)
+		}
+	}
+}
+
+func TestGetGraphInDotFormatForFrameOnlyIncludesThatFramesNodes(t *testing.T) {
+	g := makeTwoFrameGraph()
+
+	dot := string(g.getGraphInDotFormatForFrame(1))
+	if !bytes.Contains([]byte(dot), []byte("1 -> 2")) {
+		t.Errorf("expected frame 1's subgraph to contain edge 1 -> 2, got %s", dot)
+	}
+	if bytes.Contains([]byte(dot), []byte("3 -> 4")) {
+		t.Errorf("did not expect frame 1's subgraph to contain edge 3 -> 4, got %s", dot)
+	}
+}
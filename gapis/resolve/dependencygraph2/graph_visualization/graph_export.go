@@ -0,0 +1,272 @@
+// Copyright (C) 2018 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package graph_visualization
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"html"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Format identifies one of the serialisations a graph can be exported as, so
+// callers (e.g. upstream RPC handlers) can select one at runtime instead of
+// hardcoding a single format.
+type Format int
+
+const (
+	FormatDot Format = iota
+	FormatPbtxt
+	FormatGraphML
+	FormatGEXF
+	FormatJSON
+)
+
+func (f Format) String() string {
+	switch f {
+	case FormatDot:
+		return "dot"
+	case FormatPbtxt:
+		return "pbtxt"
+	case FormatGraphML:
+		return "graphml"
+	case FormatGEXF:
+		return "gexf"
+	case FormatJSON:
+		return "json"
+	default:
+		return fmt.Sprintf("Format(%d)", int(f))
+	}
+}
+
+// WriteGraph writes the graph to w in the given format. Unlike the
+// []byte-returning getGraphIn*Format helpers, it never buffers the whole
+// graph in memory, so it is suitable for very large captures.
+func (g *graph) WriteGraph(w io.Writer, format Format) error {
+	switch format {
+	case FormatDot:
+		return g.writeGraphInDotFormat(w)
+	case FormatPbtxt:
+		return g.writeGraphInPbtxtFormat(w)
+	case FormatGraphML:
+		return g.writeGraphInGraphMLFormat(w)
+	case FormatGEXF:
+		return g.writeGraphInGEXFFormat(w)
+	case FormatJSON:
+		return g.WriteJSON(w)
+	default:
+		return fmt.Errorf("unknown graph export format %v", format)
+	}
+}
+
+// NewSinkWriter wraps w with gzip compression if sinkName ends in ".gz",
+// returning the writer to use and a close function that must be called
+// (even on error) to flush any buffered compressed data.
+func NewSinkWriter(sinkName string, w io.Writer) (io.Writer, func() error) {
+	if !strings.HasSuffix(sinkName, ".gz") {
+		return w, func() error { return nil }
+	}
+	gzipWriter := gzip.NewWriter(w)
+	return gzipWriter, gzipWriter.Close
+}
+
+// writeGraphInGraphMLFormat writes the graph in GraphML format to output.
+func (g *graph) writeGraphInGraphMLFormat(output io.Writer) error {
+	if _, err := io.WriteString(output, "<?xml version=\"1.0\" encoding=\"UTF-8\"?>\n"); err != nil {
+		return err
+	}
+	if _, err := io.WriteString(output, "<graphml xmlns=\"http://graphml.graphdrawing.org/xmlns\">\n"); err != nil {
+		return err
+	}
+	if _, err := io.WriteString(output, "<key id=\"label\" for=\"node\" attr.name=\"label\" attr.type=\"string\"/>\n"); err != nil {
+		return err
+	}
+	if _, err := io.WriteString(output, "<graph id=\"g\" edgedefault=\"directed\">\n"); err != nil {
+		return err
+	}
+
+	for _, currentNode := range g.getSortedNodes() {
+		if _, err := fmt.Fprintf(output, "<node id=\"n%d\"><data key=\"label\">%s</data></node>\n", currentNode.id, html.EscapeString(currentNode.label)); err != nil {
+			return err
+		}
+	}
+	for _, currentEdge := range g.getSortedEdges() {
+		if _, err := fmt.Fprintf(output, "<edge id=\"e%d\" source=\"n%d\" target=\"n%d\"/>\n", currentEdge.id, currentEdge.source.id, currentEdge.sink.id); err != nil {
+			return err
+		}
+	}
+
+	_, err := io.WriteString(output, "</graph>\n</graphml>\n")
+	return err
+}
+
+func (g *graph) getGraphInGraphMLFormat() []byte {
+	var output bytes.Buffer
+	g.writeGraphInGraphMLFormat(&output)
+	return output.Bytes()
+}
+
+// writeGraphInGEXFFormat writes the graph in Gephi GEXF format to output.
+func (g *graph) writeGraphInGEXFFormat(output io.Writer) error {
+	if _, err := io.WriteString(output, "<?xml version=\"1.0\" encoding=\"UTF-8\"?>\n"); err != nil {
+		return err
+	}
+	if _, err := io.WriteString(output, "<gexf xmlns=\"http://www.gexf.net/1.2draft\" version=\"1.2\">\n"); err != nil {
+		return err
+	}
+	if _, err := io.WriteString(output, "<graph mode=\"static\" defaultedgetype=\"directed\">\n"); err != nil {
+		return err
+	}
+
+	if _, err := io.WriteString(output, "<nodes>\n"); err != nil {
+		return err
+	}
+	for _, currentNode := range g.getSortedNodes() {
+		if _, err := fmt.Fprintf(output, "<node id=\"%d\" label=\"%s\"/>\n", currentNode.id, html.EscapeString(currentNode.label)); err != nil {
+			return err
+		}
+	}
+	if _, err := io.WriteString(output, "</nodes>\n"); err != nil {
+		return err
+	}
+
+	if _, err := io.WriteString(output, "<edges>\n"); err != nil {
+		return err
+	}
+	for _, currentEdge := range g.getSortedEdges() {
+		if _, err := fmt.Fprintf(output, "<edge id=\"%d\" source=\"%d\" target=\"%d\"/>\n", currentEdge.id, currentEdge.source.id, currentEdge.sink.id); err != nil {
+			return err
+		}
+	}
+	if _, err := io.WriteString(output, "</edges>\n"); err != nil {
+		return err
+	}
+
+	_, err := io.WriteString(output, "</graph>\n</gexf>\n")
+	return err
+}
+
+func (g *graph) getGraphInGEXFFormat() []byte {
+	var output bytes.Buffer
+	g.writeGraphInGEXFFormat(&output)
+	return output.Bytes()
+}
+
+// getSortedEdges returns every edge in the graph ordered by id, so exports
+// are deterministic across runs.
+func (g *graph) getSortedEdges() []*edge {
+	edges := make([]*edge, 0, len(g.edgeIdToEdge))
+	for _, currentEdge := range g.edgeIdToEdge {
+		edges = append(edges, currentEdge)
+	}
+	sort.Slice(edges, func(i, j int) bool { return edges[i].id < edges[j].id })
+	return edges
+}
+
+// jsonNode and jsonEdge mirror the schema emitted by WriteJSON.
+type jsonNode struct {
+	Id           int    `json:"id"`
+	Label        string `json:"label"`
+	Attributes   string `json:"attributes"`
+	Frame        int    `json:"frame"`
+	Scc          int    `json:"scc"`
+	IsEndOfFrame bool   `json:"isEndOfFrame"`
+}
+
+type jsonEdge struct {
+	Source int    `json:"source"`
+	Sink   int    `json:"sink"`
+	Id     int    `json:"id"`
+	Label  string `json:"label"`
+}
+
+// WriteJSON streams the graph to output as a single JSON object with "nodes"
+// and "edges" arrays. Each node and edge is marshalled and written as soon
+// as it is visited, so the whole graph is never buffered in memory at once.
+func (g *graph) WriteJSON(output io.Writer) error {
+	encoder := json.NewEncoder(output)
+
+	if _, err := io.WriteString(output, `{"nodes":[`); err != nil {
+		return err
+	}
+	for i, currentNode := range g.getSortedNodes() {
+		if i > 0 {
+			if _, err := io.WriteString(output, ","); err != nil {
+				return err
+			}
+		}
+		frameNumber, _ := parseFrameNumber(currentNode.label)
+		sccId, _ := parseSccId(currentNode.label)
+		if err := encoder.Encode(jsonNode{
+			Id:           currentNode.id,
+			Label:        currentNode.label,
+			Attributes:   currentNode.attributes,
+			Frame:        frameNumber,
+			Scc:          sccId,
+			IsEndOfFrame: currentNode.isEndOfFrame,
+		}); err != nil {
+			return err
+		}
+	}
+
+	if _, err := io.WriteString(output, `],"edges":[`); err != nil {
+		return err
+	}
+	for i, currentEdge := range g.getSortedEdges() {
+		if i > 0 {
+			if _, err := io.WriteString(output, ","); err != nil {
+				return err
+			}
+		}
+		if err := encoder.Encode(jsonEdge{
+			Source: currentEdge.source.id,
+			Sink:   currentEdge.sink.id,
+			Id:     currentEdge.id,
+			Label:  currentEdge.label,
+		}); err != nil {
+			return err
+		}
+	}
+
+	_, err := io.WriteString(output, "]}\n")
+	return err
+}
+
+// parseSccId extracts n from a label containing a "SCCn" component, as
+// written by makeStronglyConnectedComponentsByCommandTypeId.
+func parseSccId(label string) (int, bool) {
+	idx := strings.Index(label, "SCC")
+	if idx < 0 {
+		return 0, false
+	}
+	rest := label[idx+len("SCC"):]
+	end := 0
+	for end < len(rest) && rest[end] >= '0' && rest[end] <= '9' {
+		end++
+	}
+	if end == 0 {
+		return 0, false
+	}
+	sccId, err := strconv.Atoi(rest[:end])
+	if err != nil {
+		return 0, false
+	}
+	return sccId, true
+}
@@ -0,0 +1,132 @@
+// Copyright (C) 2018 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package graph_visualization
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"testing"
+)
+
+func makeSimpleGraph() *graph {
+	g := createGraph(2)
+	g.addEdgeBetweenNodesById(1, 2)
+	g.nodeIdToNode[1].label = "A"
+	g.nodeIdToNode[2].label = "B<C>"
+	return g
+}
+
+func TestWriteGraphDispatchesOnFormat(t *testing.T) {
+	g := makeSimpleGraph()
+	for _, format := range []Format{FormatDot, FormatPbtxt, FormatGraphML, FormatGEXF, FormatJSON} {
+		var buf bytes.Buffer
+		if err := g.WriteGraph(&buf, format); err != nil {
+			t.Errorf("WriteGraph(%v) returned an error: %v", format, err)
+		}
+		if buf.Len() == 0 {
+			t.Errorf("WriteGraph(%v) wrote nothing", format)
+		}
+	}
+}
+
+func TestWriteGraphUnknownFormat(t *testing.T) {
+	g := makeSimpleGraph()
+	var buf bytes.Buffer
+	if err := g.WriteGraph(&buf, Format(99)); err == nil {
+		t.Errorf("expected an error for an unknown format")
+	}
+}
+
+func TestGetGraphInGraphMLFormatEscapesLabels(t *testing.T) {
+	g := makeSimpleGraph()
+	graphML := string(g.getGraphInGraphMLFormat())
+	if bytes.Contains([]byte(graphML), []byte("B<C>")) {
+		t.Errorf("expected the label to be escaped, got %s", graphML)
+	}
+	if !bytes.Contains([]byte(graphML), []byte("B&lt;C&gt;")) {
+		t.Errorf("expected the escaped label in the output, got %s", graphML)
+	}
+}
+
+func TestGetGraphInGEXFFormatContainsNodesAndEdges(t *testing.T) {
+	g := makeSimpleGraph()
+	gexf := string(g.getGraphInGEXFFormat())
+	if !bytes.Contains([]byte(gexf), []byte(`id="1"`)) || !bytes.Contains([]byte(gexf), []byte(`source="1" target="2"`)) {
+		t.Errorf("expected GEXF output to describe node 1 and the 1 -> 2 edge, got %s", gexf)
+	}
+}
+
+func TestWriteJSONEncodesNodesAndEdges(t *testing.T) {
+	g := makeSimpleGraph()
+
+	var buf bytes.Buffer
+	if err := g.WriteJSON(&buf); err != nil {
+		t.Fatalf("WriteJSON returned an error: %v", err)
+	}
+
+	var decoded struct {
+		Nodes []jsonNode `json:"nodes"`
+		Edges []jsonEdge `json:"edges"`
+	}
+	if err := json.Unmarshal(buf.Bytes(), &decoded); err != nil {
+		t.Fatalf("WriteJSON did not produce valid JSON: %v\n%s", err, buf.String())
+	}
+
+	if len(decoded.Nodes) != 2 {
+		t.Errorf("expected 2 nodes, got %d", len(decoded.Nodes))
+	}
+	if len(decoded.Edges) != 1 {
+		t.Errorf("expected 1 edge, got %d", len(decoded.Edges))
+	}
+}
+
+func TestNewSinkWriterCompressesGzSinks(t *testing.T) {
+	g := makeSimpleGraph()
+
+	var buf bytes.Buffer
+	w, closeSink := NewSinkWriter("graph.dot.gz", &buf)
+	if err := g.WriteGraph(w, FormatDot); err != nil {
+		t.Fatalf("WriteGraph returned an error: %v", err)
+	}
+	if err := closeSink(); err != nil {
+		t.Fatalf("close returned an error: %v", err)
+	}
+
+	gzipReader, err := gzip.NewReader(&buf)
+	if err != nil {
+		t.Fatalf("expected gzip-compressed output for a .gz sink, got error: %v", err)
+	}
+	decompressed, err := ioutil.ReadAll(gzipReader)
+	if err != nil {
+		t.Fatalf("failed to decompress output: %v", err)
+	}
+	if !bytes.Contains(decompressed, []byte("digraph g {")) {
+		t.Errorf("expected decompressed output to be a DOT graph, got %s", decompressed)
+	}
+}
+
+func TestNewSinkWriterPassesThroughNonGzSinks(t *testing.T) {
+	var buf bytes.Buffer
+	w, closeSink := NewSinkWriter("graph.dot", &buf)
+	if w != io.Writer(&buf) {
+		t.Errorf("expected a non-.gz sink to be passed through unchanged")
+	}
+	if err := closeSink(); err != nil {
+		t.Errorf("expected close to be a no-op for a non-.gz sink, got %v", err)
+	}
+}
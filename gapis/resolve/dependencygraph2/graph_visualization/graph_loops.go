@@ -0,0 +1,427 @@
+// Copyright (C) 2018 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package graph_visualization
+
+import (
+	"fmt"
+	"sort"
+)
+
+// Loop is an ordered list of node ids forming a simple (elementary) cycle:
+// consecutive ids are connected by an edge, and the last id connects back to
+// the first.
+type Loop []int
+
+// LoopOptions bounds the cost of enumerating cycles on large graphs.
+type LoopOptions struct {
+	// MaxLoopsPerComponent caps how many loops are returned per strongly
+	// connected component. Zero means unlimited.
+	MaxLoopsPerComponent int
+	// MinLength drops loops shorter than this many nodes. Zero or one
+	// means no filtering.
+	MinLength int
+}
+
+// HasCycle reports whether the graph contains at least one cycle, i.e. any
+// strongly connected component of size >= 2, or a single node with an edge
+// to itself.
+func (g *graph) HasCycle() bool {
+	idInStronglyConnectedComponents := g.getIdInStronglyConnectedComponents()
+	componentSize := map[int]int{}
+	for _, currentNode := range g.nodeIdToNode {
+		componentSize[idInStronglyConnectedComponents[currentNode.id]]++
+	}
+	for _, currentNode := range g.nodeIdToNode {
+		id := idInStronglyConnectedComponents[currentNode.id]
+		if componentSize[id] >= 2 {
+			return true
+		}
+		if _, ok := currentNode.outNeighbourIdToEdgeId[currentNode.id]; ok {
+			return true
+		}
+	}
+	return false
+}
+
+// FindLoops enumerates the graph's elementary circuits. It is built on top
+// of the existing SCC pass: for every strongly connected component of size
+// >= 2 (or a single node with a self-edge), Johnson's algorithm is run
+// restricted to that component to enumerate its elementary circuits.
+//
+// The number of elementary circuits in a dense component can be enormous
+// (a complete digraph on n nodes has a factorial number of them), so on a
+// graph that may contain one, prefer FindLoopsWithOptions with a
+// MaxLoopsPerComponent and/or MinLength set instead of calling this
+// unbounded.
+func (g *graph) FindLoops() []Loop {
+	return g.FindLoopsWithOptions(LoopOptions{})
+}
+
+// FindLoopsWithOptions is FindLoops with caps on the amount of work done per
+// component, so it stays tractable on large command dependency graphs.
+func (g *graph) FindLoopsWithOptions(opts LoopOptions) []Loop {
+	components := g.getNodesByComponent()
+
+	loops := []Loop{}
+	for _, componentNodeIds := range components {
+		if len(componentNodeIds) == 1 {
+			nodeId := componentNodeIds[0]
+			if _, ok := g.nodeIdToNode[nodeId].outNeighbourIdToEdgeId[nodeId]; ok && opts.MinLength <= 1 {
+				loops = append(loops, Loop{nodeId})
+			}
+			continue
+		}
+		loops = append(loops, findLoopsInComponent(g, componentNodeIds, opts)...)
+	}
+	return loops
+}
+
+// getNodesByComponent groups node ids by strongly connected component id,
+// with each group's members sorted for determinism.
+func (g *graph) getNodesByComponent() [][]int {
+	idInStronglyConnectedComponents := g.getIdInStronglyConnectedComponents()
+	nodeIdsByComponent := map[int][]int{}
+	for _, currentNode := range g.getSortedNodes() {
+		id := idInStronglyConnectedComponents[currentNode.id]
+		nodeIdsByComponent[id] = append(nodeIdsByComponent[id], currentNode.id)
+	}
+
+	components := make([][]int, 0, len(nodeIdsByComponent))
+	for _, nodeIds := range nodeIdsByComponent {
+		components = append(components, nodeIds)
+	}
+	// Order components by their smallest member id so output is stable.
+	sort.Slice(components, func(i, j int) bool { return components[i][0] < components[j][0] })
+	return components
+}
+
+// johnson holds the state of a single run of Johnson's elementary-circuit
+// algorithm, restricted to the nodes of one strongly connected component,
+// searching for circuits through a single designated start node.
+type johnson struct {
+	g           *graph
+	inComponent map[int]bool
+	opts        LoopOptions
+	blocked     map[int]bool
+	blockedBy   map[int]map[int]bool
+	stack       []int
+	loops       []Loop
+	startNodeId int
+}
+
+// findLoopsInComponent enumerates the elementary circuits of the subgraph
+// induced by componentNodeIds using Johnson's algorithm.
+//
+// A naive reading of Johnson's algorithm restarts a DFS from every node of
+// the component, which is only cheap because each restart also shrinks the
+// subgraph: once a start node's circuits are exhausted it is removed, and
+// the strongly connected components of what remains are recomputed so that
+// later restarts only search the (usually much smaller) piece that is still
+// cyclic. Skipping that peeling step turns a single large cycle - the exact
+// shape a capture's command dependency graph can have at frame scale - into
+// O(n^2) work for zero extra circuits, so it is done here via an explicit
+// worklist of strongly connected components instead of a flat node list.
+func findLoopsInComponent(g *graph, componentNodeIds []int, opts LoopOptions) []Loop {
+	loops := []Loop{}
+	worklist := [][]int{componentNodeIds}
+
+	for len(worklist) > 0 {
+		if opts.MaxLoopsPerComponent > 0 && len(loops) >= opts.MaxLoopsPerComponent {
+			break
+		}
+
+		scc := worklist[len(worklist)-1]
+		worklist = worklist[:len(worklist)-1]
+		if len(scc) < 2 {
+			// A peeled-off single node is only a circuit in its own right if
+			// it has a self-edge; Johnson's algorithm never visits it again
+			// once it has been removed from the worklist, so that has to be
+			// checked here rather than relying on the loop below.
+			nodeId := scc[0]
+			if _, ok := g.nodeIdToNode[nodeId].outNeighbourIdToEdgeId[nodeId]; ok && opts.MinLength <= 1 {
+				loops = append(loops, Loop{nodeId})
+			}
+			continue
+		}
+
+		inComponent := map[int]bool{}
+		for _, id := range scc {
+			inComponent[id] = true
+		}
+
+		runOpts := opts
+		if opts.MaxLoopsPerComponent > 0 {
+			// Each johnson run only sees its own loop count, so without this
+			// its cap would bound each peeled sub-component independently
+			// instead of the whole original component, letting the total
+			// exceed MaxLoopsPerComponent.
+			runOpts.MaxLoopsPerComponent = opts.MaxLoopsPerComponent - len(loops)
+		}
+
+		start := scc[0]
+		j := &johnson{g: g, inComponent: inComponent, opts: runOpts, blocked: map[int]bool{}, blockedBy: map[int]map[int]bool{}, startNodeId: start}
+		j.circuit(start, start)
+		loops = append(loops, j.loops...)
+
+		remaining := scc[1:]
+		if len(remaining) > 0 {
+			worklist = append(worklist, g.inducedStronglyConnectedComponents(remaining)...)
+		}
+	}
+	return loops
+}
+
+// componentNeighbours returns the sorted ids of v's out-neighbours that are
+// still members of the (shrinking) component being searched.
+func (j *johnson) componentNeighbours(v int) []int {
+	neighbours := []int{}
+	for neighbourId := range j.g.nodeIdToNode[v].outNeighbourIdToEdgeId {
+		if j.inComponent[neighbourId] {
+			neighbours = append(neighbours, neighbourId)
+		}
+	}
+	sort.Ints(neighbours)
+	return neighbours
+}
+
+// inducedStronglyConnectedComponents computes the strongly connected
+// components of the subgraph induced by nodeIds, considering only edges
+// whose endpoints both lie in nodeIds. It is the same iterative Tarjan
+// approach as getIdInStronglyConnectedComponents, but keyed by maps instead
+// of maxNodeId-sized arrays so it can be run cheaply on an arbitrary subset
+// of the graph's nodes.
+func (g *graph) inducedStronglyConnectedComponents(nodeIds []int) [][]int {
+	inSet := make(map[int]bool, len(nodeIds))
+	for _, id := range nodeIds {
+		inSet[id] = true
+	}
+
+	type tarjanSetFrame struct {
+		node       int
+		neighbours []int
+		nextIndex  int
+	}
+
+	visitTime := map[int]int{}
+	minVisitTime := map[int]int{}
+	onStack := map[int]bool{}
+	sccStack := []int{}
+	currentTime := 1
+	components := [][]int{}
+	var callStack []*tarjanSetFrame
+
+	neighboursIn := func(v int) []int {
+		neighbours := []int{}
+		for neighbourId := range g.nodeIdToNode[v].outNeighbourIdToEdgeId {
+			if inSet[neighbourId] {
+				neighbours = append(neighbours, neighbourId)
+			}
+		}
+		sort.Ints(neighbours)
+		return neighbours
+	}
+
+	pushFrame := func(v int) {
+		visitTime[v] = currentTime
+		minVisitTime[v] = currentTime
+		currentTime++
+		sccStack = append(sccStack, v)
+		onStack[v] = true
+		callStack = append(callStack, &tarjanSetFrame{node: v, neighbours: neighboursIn(v)})
+	}
+
+	for _, s := range nodeIds {
+		if visitTime[s] != 0 {
+			continue
+		}
+		pushFrame(s)
+
+		for len(callStack) > 0 {
+			frame := callStack[len(callStack)-1]
+			v := frame.node
+
+			if frame.nextIndex < len(frame.neighbours) {
+				w := frame.neighbours[frame.nextIndex]
+				frame.nextIndex++
+				if visitTime[w] == 0 {
+					pushFrame(w)
+					continue
+				}
+				if onStack[w] && visitTime[w] < minVisitTime[v] {
+					minVisitTime[v] = visitTime[w]
+				}
+				continue
+			}
+
+			callStack = callStack[:len(callStack)-1]
+			if minVisitTime[v] == visitTime[v] {
+				component := []int{}
+				for {
+					last := sccStack[len(sccStack)-1]
+					sccStack = sccStack[:len(sccStack)-1]
+					onStack[last] = false
+					component = append(component, last)
+					if last == v {
+						break
+					}
+				}
+				sort.Ints(component)
+				components = append(components, component)
+			}
+			if len(callStack) > 0 {
+				parent := callStack[len(callStack)-1].node
+				if minVisitTime[v] < minVisitTime[parent] {
+					minVisitTime[parent] = minVisitTime[v]
+				}
+			}
+		}
+	}
+	return components
+}
+
+func (j *johnson) circuit(v, s int) bool {
+	if j.opts.MaxLoopsPerComponent > 0 && len(j.loops) >= j.opts.MaxLoopsPerComponent {
+		return false
+	}
+
+	found := false
+	j.stack = append(j.stack, v)
+	j.blocked[v] = true
+
+	for _, w := range j.componentNeighbours(v) {
+		if w == s {
+			if j.opts.MinLength <= 1 || len(j.stack) >= j.opts.MinLength {
+				loop := make(Loop, len(j.stack))
+				copy(loop, j.stack)
+				j.loops = append(j.loops, loop)
+			}
+			found = true
+			if j.opts.MaxLoopsPerComponent > 0 && len(j.loops) >= j.opts.MaxLoopsPerComponent {
+				break
+			}
+		} else if !j.blocked[w] {
+			if j.circuit(w, s) {
+				found = true
+			}
+		}
+	}
+
+	if found {
+		j.unblock(v)
+	} else {
+		for _, w := range j.componentNeighbours(v) {
+			if j.blockedBy[w] == nil {
+				j.blockedBy[w] = map[int]bool{}
+			}
+			j.blockedBy[w][v] = true
+		}
+	}
+
+	j.stack = j.stack[:len(j.stack)-1]
+	return found
+}
+
+func (j *johnson) unblock(u int) {
+	j.blocked[u] = false
+	for w := range j.blockedBy[u] {
+		delete(j.blockedBy[u], w)
+		if j.blocked[w] {
+			j.unblock(w)
+		}
+	}
+}
+
+// shortestCycleInComponent finds the shortest elementary cycle lying within
+// a strongly connected component, without enumerating every cycle the way
+// FindLoops does. For every node it runs a BFS restricted to the component
+// and stops as soon as an edge back to that node is found, which - because
+// BFS visits nodes in non-decreasing distance order - gives the shortest
+// cycle through that node. This keeps annotating SCC labels with a
+// representative cycle cheap even on components with a combinatorial
+// number of elementary circuits (e.g. a dense command-type graph), where
+// full enumeration would be intractable.
+func shortestCycleInComponent(g *graph, componentNodeIds []int) (Loop, bool) {
+	inComponent := make(map[int]bool, len(componentNodeIds))
+	for _, id := range componentNodeIds {
+		inComponent[id] = true
+	}
+
+	// A self-edge is a cycle of length 1, shorter than any BFS below can
+	// stop early on, so check for one first.
+	for _, id := range componentNodeIds {
+		if _, ok := g.nodeIdToNode[id].outNeighbourIdToEdgeId[id]; ok {
+			return Loop{id}, true
+		}
+	}
+
+	var best Loop
+	for _, start := range componentNodeIds {
+		if best != nil && len(best) <= 2 {
+			break
+		}
+		if cycle, ok := shortestCycleFrom(g, inComponent, start); ok {
+			if best == nil || len(cycle) < len(best) {
+				best = cycle
+			}
+		}
+	}
+	if best == nil {
+		return nil, false
+	}
+	return best, true
+}
+
+// shortestCycleFrom runs a BFS from start, restricted to inComponent, and
+// returns the shortest cycle through start as soon as one closes.
+func shortestCycleFrom(g *graph, inComponent map[int]bool, start int) (Loop, bool) {
+	parent := map[int]int{start: -1}
+	queue := []int{start}
+
+	for qi := 0; qi < len(queue); qi++ {
+		v := queue[qi]
+		for _, w := range g.getSortedNeighbourIds(g.nodeIdToNode[v].outNeighbourIdToEdgeId) {
+			if !inComponent[w] {
+				continue
+			}
+			if w == start {
+				path := []int{}
+				for cur := v; cur != -1; cur = parent[cur] {
+					path = append(path, cur)
+				}
+				for i, j := 0, len(path)-1; i < j; i, j = i+1, j-1 {
+					path[i], path[j] = path[j], path[i]
+				}
+				return Loop(path), true
+			}
+			if _, seen := parent[w]; !seen {
+				parent[w] = v
+				queue = append(queue, w)
+			}
+		}
+	}
+	return nil, false
+}
+
+// String renders a loop as "1->2->3->1", useful for labels and logging.
+func (l Loop) String() string {
+	if len(l) == 0 {
+		return ""
+	}
+	s := fmt.Sprintf("%d", l[0])
+	for _, id := range l[1:] {
+		s += fmt.Sprintf("->%d", id)
+	}
+	return s + fmt.Sprintf("->%d", l[0])
+}
@@ -0,0 +1,247 @@
+// Copyright (C) 2018 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package graph_visualization
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestHasCycleFalseOnDag(t *testing.T) {
+	g := createGraph(3)
+	g.addEdgeBetweenNodesById(1, 2)
+	g.addEdgeBetweenNodesById(2, 3)
+
+	if g.HasCycle() {
+		t.Errorf("expected a DAG to report no cycle")
+	}
+	if loops := g.FindLoops(); len(loops) != 0 {
+		t.Errorf("expected no loops in a DAG, got %v", loops)
+	}
+}
+
+func TestHasCycleTrueOnSelfEdge(t *testing.T) {
+	g := createGraph(1)
+	g.addEdgeBetweenNodesById(1, 1)
+
+	if !g.HasCycle() {
+		t.Errorf("expected a self-edge to report a cycle")
+	}
+	loops := g.FindLoops()
+	if len(loops) != 1 || loops[0].String() != "1->1" {
+		t.Errorf("expected a single self-loop, got %v", loops)
+	}
+}
+
+func TestFindLoopsSimpleTriangle(t *testing.T) {
+	g := createGraph(3)
+	g.addEdgeBetweenNodesById(1, 2)
+	g.addEdgeBetweenNodesById(2, 3)
+	g.addEdgeBetweenNodesById(3, 1)
+
+	if !g.HasCycle() {
+		t.Fatalf("expected a triangle to report a cycle")
+	}
+	loops := g.FindLoops()
+	if len(loops) != 1 {
+		t.Fatalf("expected exactly one elementary circuit in a triangle, got %v", loops)
+	}
+	if len(loops[0]) != 3 {
+		t.Errorf("expected the loop to have 3 nodes, got %v", loops[0])
+	}
+}
+
+func TestFindLoopsTwoOverlappingCycles(t *testing.T) {
+	// 1 <-> 2 <-> 3, two 2-node loops sharing node 2.
+	g := createGraph(3)
+	g.addEdgeBetweenNodesById(1, 2)
+	g.addEdgeBetweenNodesById(2, 1)
+	g.addEdgeBetweenNodesById(2, 3)
+	g.addEdgeBetweenNodesById(3, 2)
+
+	loops := g.FindLoops()
+	if len(loops) != 2 {
+		t.Fatalf("expected 2 elementary circuits, got %v", loops)
+	}
+	for _, loop := range loops {
+		if len(loop) != 2 {
+			t.Errorf("expected each loop to have 2 nodes, got %v", loop)
+		}
+	}
+}
+
+func TestFindLoopsWithOptionsCapsPerComponent(t *testing.T) {
+	// A complete-ish component on 4 nodes has several elementary circuits.
+	g := createGraph(4)
+	g.addEdgeBetweenNodesById(1, 2)
+	g.addEdgeBetweenNodesById(2, 3)
+	g.addEdgeBetweenNodesById(3, 4)
+	g.addEdgeBetweenNodesById(4, 1)
+	g.addEdgeBetweenNodesById(2, 1)
+	g.addEdgeBetweenNodesById(3, 2)
+
+	loops := g.FindLoopsWithOptions(LoopOptions{MaxLoopsPerComponent: 1})
+	if len(loops) != 1 {
+		t.Fatalf("expected the cap to limit output to 1 loop, got %v", loops)
+	}
+}
+
+// TestFindLoopsWithOptionsCapsAcrossPeeledSubComponents is a regression
+// test for findLoopsInComponent's worklist: MaxLoopsPerComponent must bound
+// the total number of loops found in the original component, not just the
+// loops found by whichever peeled sub-component's johnson run is currently
+// executing.
+func TestFindLoopsWithOptionsCapsAcrossPeeledSubComponents(t *testing.T) {
+	// Node 1 bridges into an 8-node complete digraph (nodes 2-9), so the
+	// component has many more than 3 elementary circuits once node 1 is
+	// peeled off and the dense remainder is searched.
+	const numberOfDenseNodes = 8
+	g := createGraph(1 + numberOfDenseNodes)
+	g.addEdgeBetweenNodesById(1, 2)
+	g.addEdgeBetweenNodesById(2, 1)
+	for i := 2; i <= 1+numberOfDenseNodes; i++ {
+		for j := 2; j <= 1+numberOfDenseNodes; j++ {
+			if i != j {
+				g.addEdgeBetweenNodesById(i, j)
+			}
+		}
+	}
+
+	loops := g.FindLoopsWithOptions(LoopOptions{MaxLoopsPerComponent: 3})
+	if len(loops) != 3 {
+		t.Fatalf("expected the cap to limit the whole component to 3 loops, got %d: %v", len(loops), loops)
+	}
+}
+
+func TestFindLoopsWithOptionsFiltersByMinLength(t *testing.T) {
+	g := createGraph(3)
+	g.addEdgeBetweenNodesById(1, 2)
+	g.addEdgeBetweenNodesById(2, 1)
+	g.addEdgeBetweenNodesById(1, 3)
+	g.addEdgeBetweenNodesById(3, 1)
+
+	loops := g.FindLoopsWithOptions(LoopOptions{MinLength: 3})
+	if len(loops) != 0 {
+		t.Errorf("expected no 2-node loops to pass a MinLength of 3, got %v", loops)
+	}
+}
+
+func TestFindLoopsWithOptionsFiltersSelfLoopByMinLength(t *testing.T) {
+	g := createGraph(1)
+	g.addEdgeBetweenNodesById(1, 1)
+
+	loops := g.FindLoopsWithOptions(LoopOptions{MinLength: 2})
+	if len(loops) != 0 {
+		t.Errorf("expected a length-1 self-loop to be dropped by a MinLength of 2, got %v", loops)
+	}
+}
+
+// TestFindLoopsEnumeratesSelfLoopPeeledFromComponent is a regression test
+// for findLoopsInComponent's worklist: peeling the cycle's start node off a
+// multi-node component produces a size-1 sub-component for the remaining
+// self-looped node, which must still be reported rather than silently
+// discarded just because it is no longer the component Johnson's algorithm
+// started from.
+func TestFindLoopsEnumeratesSelfLoopPeeledFromComponent(t *testing.T) {
+	g := createGraph(4)
+	g.addEdgeBetweenNodesById(1, 2)
+	g.addEdgeBetweenNodesById(2, 3)
+	g.addEdgeBetweenNodesById(3, 4)
+	g.addEdgeBetweenNodesById(4, 1)
+	g.addEdgeBetweenNodesById(4, 4)
+
+	loops := g.FindLoops()
+	if len(loops) != 2 {
+		t.Fatalf("expected the 4-cycle and the self-loop on node 4, got %v", loops)
+	}
+
+	foundSelfLoop := false
+	for _, loop := range loops {
+		if len(loop) == 1 && loop[0] == 4 {
+			foundSelfLoop = true
+		}
+	}
+	if !foundSelfLoop {
+		t.Errorf("expected a length-1 loop on node 4 among %v", loops)
+	}
+}
+
+func TestMakeStronglyConnectedComponentsByCommandTypeIdAnnotatesRepresentativeLoop(t *testing.T) {
+	g := createGraph(0)
+	a := getNewNode(1, "A")
+	b := getNewNode(2, "B")
+	g.addNode(a)
+	g.addNode(b)
+	a.commandTypeId = 1
+	b.commandTypeId = 2
+	g.addEdgeBetweenNodes(a, b)
+	g.addEdgeBetweenNodes(b, a)
+
+	g.makeStronglyConnectedComponentsByCommandTypeId()
+
+	if !strings.Contains(a.label, "SCC") || !strings.Contains(a.label, "[1->2->1]") {
+		t.Errorf("expected node label to be annotated with an SCC id and representative loop, got %q", a.label)
+	}
+}
+
+// TestFindLoopsLargeSingleCycleIsFast is a regression test for an unbounded
+// DFS restart on every node of a component: a single cycle of 100,000 nodes
+// has exactly one elementary circuit, so a correct implementation should
+// finish quickly, not do O(n^2) work rediscovering that there is nothing
+// left to find. This is the scale chunk0-1's iterative SCC pass was written
+// to survive, and FindLoops must survive it too.
+func TestFindLoopsLargeSingleCycleIsFast(t *testing.T) {
+	const numberOfNodes = 100000
+	g := makeChainGraph(numberOfNodes)
+	g.addEdgeBetweenNodesById(numberOfNodes, 1)
+
+	loops := g.FindLoops()
+	if len(loops) != 1 {
+		t.Fatalf("expected exactly one elementary circuit in a single cycle, got %d", len(loops))
+	}
+	if len(loops[0]) != numberOfNodes {
+		t.Errorf("expected the loop to contain all %d nodes, got %d", numberOfNodes, len(loops[0]))
+	}
+}
+
+// TestGetSmallestLoopByComponentIdOnDenseComponentIsFast is a regression
+// test for getSmallestLoopByComponentId enumerating every elementary
+// circuit of a dense strongly connected component via FindLoops: a complete
+// digraph has a combinatorial (factorial-growth) number of circuits, which
+// is exactly the shape a command-type graph can have, so finding the
+// shortest representative cycle must not enumerate them all.
+func TestGetSmallestLoopByComponentIdOnDenseComponentIsFast(t *testing.T) {
+	const numberOfNodes = 12
+	g := createGraph(numberOfNodes)
+	for i := 1; i <= numberOfNodes; i++ {
+		for j := 1; j <= numberOfNodes; j++ {
+			if i != j {
+				g.addEdgeBetweenNodesById(i, j)
+			}
+		}
+	}
+
+	idInStronglyConnectedComponents := g.getIdInStronglyConnectedComponents()
+	smallestLoopByComponentId := g.getSmallestLoopByComponentId(idInStronglyConnectedComponents)
+
+	componentId := idInStronglyConnectedComponents[1]
+	loop, ok := smallestLoopByComponentId[componentId]
+	if !ok {
+		t.Fatalf("expected a representative loop for the dense component")
+	}
+	if len(loop) != 2 {
+		t.Errorf("expected the shortest cycle in a complete digraph to have 2 nodes, got %v", loop)
+	}
+}
@@ -17,6 +17,7 @@ package graph_visualization
 import (
 	"bytes"
 	"fmt"
+	"io"
 	"sort"
 )
 
@@ -197,35 +198,77 @@ func (input nodeSorter) Less(i, j int) bool {
 	return input[i].id < input[j].id
 }
 
-func (g *graph) traverseGraph(currentNode *node, visitTime, minVisitTime, idInStronglyConnectedComponents, visitedNodesId *[]int, currentId, currentTime *int) {
-	*visitedNodesId = append(*visitedNodesId, currentNode.id)
-	(*visitTime)[currentNode.id] = *currentTime
-	(*minVisitTime)[currentNode.id] = *currentTime
-	(*currentTime)++
+// tarjanFrame captures the state of a single (would-be) stack frame of the
+// recursive Tarjan DFS: the node it is visiting and how far it has gotten
+// through that node's (sorted, for determinism) outgoing neighbours.
+type tarjanFrame struct {
+	node       *node
+	neighbours []int
+	nextIndex  int
+}
+
+// traverseGraph runs Tarjan's strongly-connected-components algorithm
+// starting from startNode, using an explicit callStack instead of Go's call
+// stack so it does not overflow on deep command graphs. It mirrors the
+// classic recursive formulation frame-for-frame: pushing a frame is
+// equivalent to entering a recursive call, and popping one is equivalent to
+// returning from it. Neighbours are visited in sorted order so the resulting
+// SCC ids are stable across runs.
+func (g *graph) traverseGraph(startNode *node, visitTime, minVisitTime, idInStronglyConnectedComponents []int, currentId, currentTime *int) {
+	callStack := []*tarjanFrame{}
+	sccStack := []int{}
+	onStack := make([]bool, g.maxNodeId+1)
+
+	pushFrame := func(n *node) {
+		visitTime[n.id] = *currentTime
+		minVisitTime[n.id] = *currentTime
+		*currentTime++
+		sccStack = append(sccStack, n.id)
+		onStack[n.id] = true
+		callStack = append(callStack, &tarjanFrame{node: n, neighbours: g.getSortedNeighbourIds(n.outNeighbourIdToEdgeId)})
+	}
+
+	pushFrame(startNode)
+
+	for len(callStack) > 0 {
+		frame := callStack[len(callStack)-1]
+		currentNode := frame.node
 
-	for neighbourId := range currentNode.outNeighbourIdToEdgeId {
-		neighbour := g.nodeIdToNode[neighbourId]
-		if (*visitTime)[neighbour.id] == NO_VISITED {
-			g.traverseGraph(neighbour, visitTime, minVisitTime, idInStronglyConnectedComponents, visitedNodesId, currentId, currentTime)
+		if frame.nextIndex < len(frame.neighbours) {
+			neighbourId := frame.neighbours[frame.nextIndex]
+			frame.nextIndex++
+			if visitTime[neighbourId] == NO_VISITED {
+				pushFrame(g.nodeIdToNode[neighbourId])
+				continue
+			}
+			if onStack[neighbourId] && visitTime[neighbourId] < minVisitTime[currentNode.id] {
+				minVisitTime[currentNode.id] = visitTime[neighbourId]
+			}
+			continue
 		}
-		if (*visitTime)[neighbour.id] != VISITED_AND_USED {
-			if (*minVisitTime)[neighbour.id] < (*minVisitTime)[currentNode.id] {
-				(*minVisitTime)[currentNode.id] = (*minVisitTime)[neighbour.id]
+
+		// All neighbours have been explored: this frame is done.
+		callStack = callStack[:len(callStack)-1]
+
+		if minVisitTime[currentNode.id] == visitTime[currentNode.id] {
+			for {
+				lastNodeId := sccStack[len(sccStack)-1]
+				sccStack = sccStack[:len(sccStack)-1]
+				onStack[lastNodeId] = false
+				idInStronglyConnectedComponents[lastNodeId] = *currentId
+				if lastNodeId == currentNode.id {
+					break
+				}
 			}
+			(*currentId)++
 		}
-	}
 
-	if (*minVisitTime)[currentNode.id] == (*visitTime)[currentNode.id] {
-		for {
-			lastNodeId := (*visitedNodesId)[len(*visitedNodesId)-1]
-			(*visitTime)[lastNodeId] = VISITED_AND_USED
-			*visitedNodesId = (*visitedNodesId)[:len(*visitedNodesId)-1]
-			(*idInStronglyConnectedComponents)[lastNodeId] = *currentId
-			if lastNodeId == currentNode.id {
-				break
+		if len(callStack) > 0 {
+			parent := callStack[len(callStack)-1].node
+			if minVisitTime[currentNode.id] < minVisitTime[parent.id] {
+				minVisitTime[parent.id] = minVisitTime[currentNode.id]
 			}
 		}
-		(*currentId)++
 	}
 }
 
@@ -235,11 +278,10 @@ func (g *graph) getIdInStronglyConnectedComponents() []int {
 	visitTime := make([]int, g.maxNodeId+1)
 	minVisitTime := make([]int, g.maxNodeId+1)
 	idInStronglyConnectedComponents := make([]int, g.maxNodeId+1)
-	visitedNodesId := make([]int, 0)
 
-	for _, currentNode := range g.nodeIdToNode {
+	for _, currentNode := range g.getSortedNodes() {
 		if visitTime[currentNode.id] == NO_VISITED {
-			g.traverseGraph(currentNode, &visitTime, &minVisitTime, &idInStronglyConnectedComponents, &visitedNodesId, &currentId, &currentTime)
+			g.traverseGraph(currentNode, visitTime, minVisitTime, idInStronglyConnectedComponents, &currentId, &currentTime)
 		}
 	}
 	return idInStronglyConnectedComponents
@@ -259,10 +301,43 @@ func (g *graph) makeStronglyConnectedComponentsByCommandTypeId() {
 		}
 	}
 	idInStronglyConnectedComponents := newGraph.getIdInStronglyConnectedComponents()
+	representativeLoopByComponentId := newGraph.getSmallestLoopByComponentId(idInStronglyConnectedComponents)
 	for _, currentNode := range g.nodeIdToNode {
 		id := idInStronglyConnectedComponents[currentNode.commandTypeId]
 		currentNode.label = currentNode.label + "/" + fmt.Sprintf("SCC%d", id)
+		if loop, ok := representativeLoopByComponentId[id]; ok {
+			currentNode.label = currentNode.label + fmt.Sprintf("[%s]", loop)
+		}
+	}
+}
+
+// getSmallestLoopByComponentId finds, for every nontrivial strongly
+// connected component (one with more than one member, or a self-edge), the
+// shortest elementary circuit it contains, keyed by component id. This is
+// used to annotate SCC labels with a representative cycle so users can see
+// at a glance why commands of a given type were grouped together.
+//
+// It deliberately does not go through FindLoops: a command-type graph can
+// have a densely connected component (every command type that can follow
+// every other), and enumerating all of a dense component's elementary
+// circuits is combinatorially expensive even when only the shortest one is
+// wanted. A BFS-based shortest-cycle search keeps this bounded.
+func (g *graph) getSmallestLoopByComponentId(idInStronglyConnectedComponents []int) map[int]Loop {
+	smallestLoopByComponentId := map[int]Loop{}
+	for _, componentNodeIds := range g.getNodesByComponent() {
+		id := idInStronglyConnectedComponents[componentNodeIds[0]]
+		if len(componentNodeIds) == 1 {
+			nodeId := componentNodeIds[0]
+			if _, ok := g.nodeIdToNode[nodeId].outNeighbourIdToEdgeId[nodeId]; ok {
+				smallestLoopByComponentId[id] = Loop{nodeId}
+			}
+			continue
+		}
+		if loop, ok := shortestCycleInComponent(g, componentNodeIds); ok {
+			smallestLoopByComponentId[id] = loop
+		}
 	}
+	return smallestLoopByComponentId
 }
 
 func (g *graph) bfs(sourceNode *node, visited []bool, visitedNodes *[]*node) {
@@ -331,48 +406,94 @@ func (g *graph) getSortedNeighbours(neighbourIdToEdgeId map[int]int) []*node {
 	return neighbours
 }
 
-func (g *graph) writeEdgesInDotFormat(output *bytes.Buffer) {
+func (g *graph) getSortedNeighbourIds(neighbourIdToEdgeId map[int]int) []int {
+	neighbourIds := make([]int, 0, len(neighbourIdToEdgeId))
+	for neighbourId := range neighbourIdToEdgeId {
+		neighbourIds = append(neighbourIds, neighbourId)
+	}
+	sort.Ints(neighbourIds)
+	return neighbourIds
+}
+
+func (g *graph) writeEdgesInDotFormat(output io.Writer) error {
 	nodes := g.getSortedNodes()
 	for _, currentNode := range nodes {
 		inNeighbours := g.getSortedNeighbours(currentNode.inNeighbourIdToEdgeId)
 		for _, neighbour := range inNeighbours {
-			fmt.Fprintf(output, "%d -> %d;\n", neighbour.id, currentNode.id)
+			if _, err := fmt.Fprintf(output, "%d -> %d;\n", neighbour.id, currentNode.id); err != nil {
+				return err
+			}
 		}
 	}
+	return nil
 }
 
-func (g *graph) writeNodesInDotFormat(output *bytes.Buffer) {
+func (g *graph) writeNodesInDotFormat(output io.Writer) error {
 	nodes := g.getSortedNodes()
 	for _, currentNode := range nodes {
-		fmt.Fprintf(output, "%d[label=%s];\n", currentNode.id, currentNode.label)
+		if _, err := fmt.Fprintf(output, "%d[label=%s];\n", currentNode.id, currentNode.label); err != nil {
+			return err
+		}
 	}
+	return nil
+}
+
+// writeGraphInDotFormat writes the graph in Graphviz DOT format to output.
+func (g *graph) writeGraphInDotFormat(output io.Writer) error {
+	if _, err := io.WriteString(output, "digraph g {\n"); err != nil {
+		return err
+	}
+	if err := g.writeNodesInDotFormat(output); err != nil {
+		return err
+	}
+	if err := g.writeEdgesInDotFormat(output); err != nil {
+		return err
+	}
+	_, err := io.WriteString(output, "}\n")
+	return err
 }
 
 func (g *graph) getGraphInDotFormat() []byte {
 	var output bytes.Buffer
-	output.WriteString("digraph g {\n")
-	g.writeNodesInDotFormat(&output)
-	g.writeEdgesInDotFormat(&output)
-	output.WriteString("}\n")
+	g.writeGraphInDotFormat(&output)
 	return output.Bytes()
 }
 
-func (g *graph) getGraphInPbtxtFormat() []byte {
+// writeGraphInPbtxtFormat writes the graph in TensorFlow pbtxt format to output.
+func (g *graph) writeGraphInPbtxtFormat(output io.Writer) error {
 	nodes := g.getSortedNodes()
-	var output bytes.Buffer
 	for _, currentNode := range nodes {
-		output.WriteString("node {\n")
-		output.WriteString("name: \"" + currentNode.label + "\"\n")
-		output.WriteString("op: \"" + currentNode.label + "\"\n")
+		if _, err := io.WriteString(output, "node {\n"); err != nil {
+			return err
+		}
+		if _, err := fmt.Fprintf(output, "name: \"%s\"\n", currentNode.label); err != nil {
+			return err
+		}
+		if _, err := fmt.Fprintf(output, "op: \"%s\"\n", currentNode.label); err != nil {
+			return err
+		}
 
 		neighbours := g.getSortedNeighbours(currentNode.inNeighbourIdToEdgeId)
 		for _, neighbour := range neighbours {
-			output.WriteString("input: \"" + neighbour.label + "\"\n")
+			if _, err := fmt.Fprintf(output, "input: \"%s\"\n", neighbour.label); err != nil {
+				return err
+			}
+		}
+		if _, err := io.WriteString(output, "attr {\n"); err != nil {
+			return err
+		}
+		if _, err := fmt.Fprintf(output, "key: \"%s\"\n", currentNode.attributes); err != nil {
+			return err
+		}
+		if _, err := io.WriteString(output, "}\n}\n"); err != nil {
+			return err
 		}
-		output.WriteString("attr {\n")
-		output.WriteString("key: \"" + currentNode.attributes + "\"\n")
-		output.WriteString("}\n")
-		output.WriteString("}\n")
 	}
+	return nil
+}
+
+func (g *graph) getGraphInPbtxtFormat() []byte {
+	var output bytes.Buffer
+	g.writeGraphInPbtxtFormat(&output)
 	return output.Bytes()
 }
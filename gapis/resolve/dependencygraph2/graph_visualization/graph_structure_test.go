@@ -0,0 +1,84 @@
+// Copyright (C) 2018 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package graph_visualization
+
+import (
+	"testing"
+)
+
+// makeChainGraph builds a graph with numberOfNodes nodes 1..numberOfNodes
+// connected in a single chain 1 -> 2 -> ... -> numberOfNodes. Every node is
+// its own strongly connected component.
+func makeChainGraph(numberOfNodes int) *graph {
+	g := createGraph(numberOfNodes)
+	for id := 1; id < numberOfNodes; id++ {
+		g.addEdgeBetweenNodesById(id, id+1)
+	}
+	return g
+}
+
+func TestGetIdInStronglyConnectedComponentsDeepChainDoesNotOverflow(t *testing.T) {
+	const numberOfNodes = 100000
+	g := makeChainGraph(numberOfNodes)
+
+	idInStronglyConnectedComponents := g.getIdInStronglyConnectedComponents()
+
+	seenComponentId := map[int]bool{}
+	for id := 1; id <= numberOfNodes; id++ {
+		componentId := idInStronglyConnectedComponents[id]
+		if seenComponentId[componentId] {
+			t.Fatalf("node %d reuses component id %d; a chain graph must have no two nodes in the same SCC", id, componentId)
+		}
+		seenComponentId[componentId] = true
+	}
+}
+
+func TestGetIdInStronglyConnectedComponentsSingleCycle(t *testing.T) {
+	const numberOfNodes = 5
+	g := createGraph(numberOfNodes)
+	for id := 1; id < numberOfNodes; id++ {
+		g.addEdgeBetweenNodesById(id, id+1)
+	}
+	g.addEdgeBetweenNodesById(numberOfNodes, 1)
+
+	idInStronglyConnectedComponents := g.getIdInStronglyConnectedComponents()
+
+	componentId := idInStronglyConnectedComponents[1]
+	for id := 2; id <= numberOfNodes; id++ {
+		if idInStronglyConnectedComponents[id] != componentId {
+			t.Fatalf("expected all nodes in the cycle to share component id %d, but node %d has %d", componentId, id, idInStronglyConnectedComponents[id])
+		}
+	}
+}
+
+func TestGetIdInStronglyConnectedComponentsIsDeterministic(t *testing.T) {
+	g := createGraph(6)
+	g.addEdgeBetweenNodesById(1, 2)
+	g.addEdgeBetweenNodesById(2, 3)
+	g.addEdgeBetweenNodesById(3, 1)
+	g.addEdgeBetweenNodesById(3, 4)
+	g.addEdgeBetweenNodesById(4, 5)
+	g.addEdgeBetweenNodesById(5, 6)
+	g.addEdgeBetweenNodesById(6, 4)
+
+	first := g.getIdInStronglyConnectedComponents()
+	second := g.getIdInStronglyConnectedComponents()
+
+	for id := 1; id <= 6; id++ {
+		if first[id] != second[id] {
+			t.Fatalf("SCC id for node %d changed across runs: %d vs %d", id, first[id], second[id])
+		}
+	}
+}
@@ -0,0 +1,158 @@
+// Copyright (C) 2018 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package graph_visualization
+
+// SubgraphOptions configures Subgraph's selection of which nodes of the
+// original graph to carry over.
+type SubgraphOptions struct {
+	// Frames, if non-empty, selects nodes labelled with one of these
+	// frame numbers by joinNodesByFrame.
+	Frames []int
+	// CommandTypeIDs, if non-empty, selects nodes with one of these
+	// commandTypeId values.
+	CommandTypeIDs []int
+	// IncludeUnused keeps nodes with no edges in the selection. By
+	// default they are dropped, since joinNodesWithZeroDegree only
+	// marks them as noise relative to a frame or command type.
+	IncludeUnused bool
+	// NeighbourHops grows the selection by this many BFS hops, following
+	// edges in either direction, so callers can pull in surrounding
+	// context around the nodes Frames/CommandTypeIDs selected.
+	NeighbourHops int
+	// DropIsolated removes nodes left with no edges once the subgraph
+	// has been built.
+	DropIsolated bool
+}
+
+// Subgraph returns a new, fully independent graph containing only the
+// nodes selected by opts and the edges between them. Nodes and edges are
+// renumbered starting at 1, but commandTypeId, attributes, subCommandNodes
+// and isEndOfFrame are preserved.
+func (g *graph) Subgraph(opts SubgraphOptions) *graph {
+	selected := g.selectSubgraphNodes(opts)
+
+	newGraph := createGraph(0)
+	oldToNewNode := map[int]*node{}
+	for _, currentNode := range g.getSortedNodes() {
+		if !selected[currentNode.id] {
+			continue
+		}
+		newNode := getNewNode(newGraph.maxNodeId+1, currentNode.label)
+		newNode.name = currentNode.name
+		newNode.attributes = currentNode.attributes
+		newNode.commandTypeId = currentNode.commandTypeId
+		newNode.isEndOfFrame = currentNode.isEndOfFrame
+		newNode.subCommandNodes = cloneSubCommandNodes(currentNode.subCommandNodes)
+		newGraph.addNode(newNode)
+		oldToNewNode[currentNode.id] = newNode
+	}
+
+	for _, currentEdge := range g.getSortedEdges() {
+		newSource, sourceOk := oldToNewNode[currentEdge.source.id]
+		newSink, sinkOk := oldToNewNode[currentEdge.sink.id]
+		if !sourceOk || !sinkOk {
+			continue
+		}
+		previousMaxEdgeId := newGraph.maxEdgeId
+		newGraph.addEdgeBetweenNodes(newSource, newSink)
+		if newGraph.maxEdgeId != previousMaxEdgeId {
+			newGraph.edgeIdToEdge[newGraph.maxEdgeId].label = currentEdge.label
+		}
+	}
+
+	if opts.DropIsolated {
+		newGraph.removeNodesWithZeroDegree()
+	}
+
+	return newGraph
+}
+
+// cloneSubCommandNodes copies a node's sub-command nodes (and, recursively,
+// theirs) so the returned graph does not share mutable state with g.
+func cloneSubCommandNodes(subCommandNodes []*node) []*node {
+	if len(subCommandNodes) == 0 {
+		return nil
+	}
+	cloned := make([]*node, len(subCommandNodes))
+	for i, subCommandNode := range subCommandNodes {
+		clone := getNewNode(subCommandNode.id, subCommandNode.label)
+		clone.name = subCommandNode.name
+		clone.attributes = subCommandNode.attributes
+		clone.commandTypeId = subCommandNode.commandTypeId
+		clone.isEndOfFrame = subCommandNode.isEndOfFrame
+		clone.subCommandNodes = cloneSubCommandNodes(subCommandNode.subCommandNodes)
+		cloned[i] = clone
+	}
+	return cloned
+}
+
+// selectSubgraphNodes computes the set of original node ids that Subgraph
+// should carry over, before renumbering.
+func (g *graph) selectSubgraphNodes(opts SubgraphOptions) map[int]bool {
+	frameSet := map[int]bool{}
+	for _, frameNumber := range opts.Frames {
+		frameSet[frameNumber] = true
+	}
+	commandTypeSet := map[int]bool{}
+	for _, commandTypeId := range opts.CommandTypeIDs {
+		commandTypeSet[commandTypeId] = true
+	}
+	noFilters := len(opts.Frames) == 0 && len(opts.CommandTypeIDs) == 0
+
+	selected := map[int]bool{}
+	for _, currentNode := range g.getSortedNodes() {
+		matches := noFilters
+		if frameNumber, ok := parseFrameNumber(currentNode.label); ok && frameSet[frameNumber] {
+			matches = true
+		}
+		if commandTypeSet[currentNode.commandTypeId] {
+			matches = true
+		}
+		if !matches {
+			continue
+		}
+		isUnused := (len(currentNode.inNeighbourIdToEdgeId) + len(currentNode.outNeighbourIdToEdgeId)) == 0
+		if isUnused && !opts.IncludeUnused {
+			continue
+		}
+		selected[currentNode.id] = true
+	}
+
+	frontier := []int{}
+	for id := range selected {
+		frontier = append(frontier, id)
+	}
+	for hop := 0; hop < opts.NeighbourHops && len(frontier) > 0; hop++ {
+		next := []int{}
+		for _, id := range frontier {
+			currentNode := g.nodeIdToNode[id]
+			for _, neighbourId := range g.getSortedNeighbourIds(currentNode.outNeighbourIdToEdgeId) {
+				if !selected[neighbourId] {
+					selected[neighbourId] = true
+					next = append(next, neighbourId)
+				}
+			}
+			for _, neighbourId := range g.getSortedNeighbourIds(currentNode.inNeighbourIdToEdgeId) {
+				if !selected[neighbourId] {
+					selected[neighbourId] = true
+					next = append(next, neighbourId)
+				}
+			}
+		}
+		frontier = next
+	}
+
+	return selected
+}
@@ -0,0 +1,131 @@
+// Copyright (C) 2018 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package graph_visualization
+
+import "testing"
+
+// makeTwoFrameChainGraph builds 1 -> 2 -> 3 (frame 1, 1 is end-of-frame)
+// and 4 -> 5 -> 6 (frame 2, 4 is end-of-frame), plus an isolated node 7.
+func makeTwoFrameChainGraph() *graph {
+	g := createGraph(7)
+	g.addEdgeBetweenNodesById(1, 2)
+	g.addEdgeBetweenNodesById(2, 3)
+	g.addEdgeBetweenNodesById(4, 5)
+	g.addEdgeBetweenNodesById(5, 6)
+	g.nodeIdToNode[1].isEndOfFrame = true
+	g.nodeIdToNode[4].isEndOfFrame = true
+	g.nodeIdToNode[1].commandTypeId = 10
+	g.nodeIdToNode[2].commandTypeId = 20
+	g.nodeIdToNode[3].commandTypeId = 30
+	g.joinNodesByFrame()
+	return g
+}
+
+func TestSubgraphByFrameSelectsOnlyThatFramesNodes(t *testing.T) {
+	g := makeTwoFrameChainGraph()
+
+	sub := g.Subgraph(SubgraphOptions{Frames: []int{1}})
+
+	if sub.getNumberOfNodes() != 3 {
+		t.Fatalf("expected frame 1's subgraph to have 3 nodes, got %d", sub.getNumberOfNodes())
+	}
+	if sub.getNumberOfEdges() != 2 {
+		t.Fatalf("expected frame 1's subgraph to have 2 edges, got %d", sub.getNumberOfEdges())
+	}
+}
+
+func TestSubgraphByCommandTypeId(t *testing.T) {
+	g := makeTwoFrameChainGraph()
+
+	sub := g.Subgraph(SubgraphOptions{CommandTypeIDs: []int{20}})
+
+	if sub.getNumberOfNodes() != 1 {
+		t.Fatalf("expected exactly the one node with commandTypeId 20, got %d", sub.getNumberOfNodes())
+	}
+}
+
+func TestSubgraphNeighbourHopsGrowsSelection(t *testing.T) {
+	g := makeTwoFrameChainGraph()
+
+	noHops := g.Subgraph(SubgraphOptions{CommandTypeIDs: []int{20}})
+	if noHops.getNumberOfNodes() != 1 {
+		t.Fatalf("expected 1 node with no hops, got %d", noHops.getNumberOfNodes())
+	}
+
+	oneHop := g.Subgraph(SubgraphOptions{CommandTypeIDs: []int{20}, NeighbourHops: 1})
+	if oneHop.getNumberOfNodes() != 3 {
+		t.Fatalf("expected growing by 1 hop to pull in both neighbours (nodes 1 and 3), got %d", oneHop.getNumberOfNodes())
+	}
+}
+
+func TestSubgraphIncludeUnused(t *testing.T) {
+	g := makeTwoFrameChainGraph()
+
+	withoutUnused := g.Subgraph(SubgraphOptions{})
+	withUnused := g.Subgraph(SubgraphOptions{IncludeUnused: true})
+
+	if withoutUnused.getNumberOfNodes() != 6 {
+		t.Errorf("expected the isolated node 7 to be dropped by default, got %d nodes", withoutUnused.getNumberOfNodes())
+	}
+	if withUnused.getNumberOfNodes() != 7 {
+		t.Errorf("expected IncludeUnused to keep the isolated node 7, got %d nodes", withUnused.getNumberOfNodes())
+	}
+}
+
+func TestSubgraphDropIsolated(t *testing.T) {
+	g := makeTwoFrameChainGraph()
+
+	// Nodes 1 and 3 are selected, but the edges joining them both go
+	// through the unselected node 2, so both are left with no edges.
+	sub := g.Subgraph(SubgraphOptions{CommandTypeIDs: []int{10, 30}, IncludeUnused: true, DropIsolated: true})
+	if sub.getNumberOfNodes() != 0 {
+		t.Errorf("expected DropIsolated to remove nodes left with no edges, got %d nodes", sub.getNumberOfNodes())
+	}
+}
+
+func TestSubgraphRoundTripsViaDotFormat(t *testing.T) {
+	g := makeTwoFrameChainGraph()
+
+	sub := g.Subgraph(SubgraphOptions{Frames: []int{1}})
+	dot := string(sub.getGraphInDotFormat())
+
+	reparsed := countDotEdges(dot)
+	if reparsed != sub.getNumberOfEdges() {
+		t.Errorf("DOT output has %d edges, graph reports %d", reparsed, sub.getNumberOfEdges())
+	}
+	if countDotNodes(dot) != sub.getNumberOfNodes() {
+		t.Errorf("DOT output has %d nodes, graph reports %d", countDotNodes(dot), sub.getNumberOfNodes())
+	}
+}
+
+func countDotEdges(dot string) int {
+	count := 0
+	for i := 0; i+4 <= len(dot); i++ {
+		if dot[i:i+4] == " -> " {
+			count++
+		}
+	}
+	return count
+}
+
+func countDotNodes(dot string) int {
+	count := 0
+	for i := 0; i+7 <= len(dot); i++ {
+		if dot[i:i+7] == "[label=" {
+			count++
+		}
+	}
+	return count
+}